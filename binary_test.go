@@ -0,0 +1,66 @@
+package hllpp
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBinaryRoundTrip(t *testing.T) {
+	h, err := New(12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2000; i++ {
+		h.Add([]byte(fmt.Sprintf("binary-element-%d", i)))
+	}
+
+	data, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got HLLPP
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Count() != h.Count() {
+		t.Errorf("got count %d, want %d", got.Count(), h.Count())
+	}
+	if got.p != h.p || got.sparse != h.sparse {
+		t.Errorf("got {p:%d sparse:%v}, want {p:%d sparse:%v}", got.p, got.sparse, h.p, h.sparse)
+	}
+}
+
+func TestBinaryUnmarshalTruncated(t *testing.T) {
+	h, err := New(12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Add([]byte("x"))
+
+	data, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got HLLPP
+	if err := got.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Fatal("expected UnmarshalBinary to reject a truncated blob")
+	}
+}
+
+func TestBinaryV1DefaultsToMurmurHasher(t *testing.T) {
+	// A minimal, hand-built v1 blob: version, p, bitsPerRegister, sparse
+	// flag, a zero-length tmpSet and a zero-length register payload. V1
+	// predates the hasher-name suffix entirely.
+	v1 := []byte{binaryVersion1, 10, denseBitsPerRegister, 1, 0, 0, 0, 0, 0, 0, 0, 0}
+
+	var got HLLPP
+	if err := got.UnmarshalBinary(v1); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got.hasher.(murmurHasher); !ok {
+		t.Errorf("expected a v1 blob to default to murmurHasher, got %T", got.hasher)
+	}
+}
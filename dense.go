@@ -0,0 +1,34 @@
+package hllpp
+
+// getRegister/setRegister read and write a single bitsPerRegister-wide
+// register out of a tightly bit-packed array (no padding byte required:
+// each register's bits never read or write past ceil(m*bitsPerRegister/8)
+// bytes). The bit layout is the same as the Redis/PipelineDB wire layouts in
+// redis.go/pipeline.go, but those accessors use the 2-byte overlap trick
+// from HLL_DENSE_{GET,SET}_REGISTER and need their own padding byte to stay
+// in bounds.
+func getRegister(data []byte, bitsPerRegister uint8, idx uint32) uint8 {
+	bitPos := uint64(idx) * uint64(bitsPerRegister)
+
+	var val uint8
+	for b := uint8(0); b < bitsPerRegister; b++ {
+		pos := bitPos + uint64(b)
+		if data[pos/8]&(1<<(pos%8)) != 0 {
+			val |= 1 << b
+		}
+	}
+	return val
+}
+
+func setRegister(data []byte, bitsPerRegister uint8, idx uint32, val uint8) {
+	bitPos := uint64(idx) * uint64(bitsPerRegister)
+
+	for b := uint8(0); b < bitsPerRegister; b++ {
+		pos := bitPos + uint64(b)
+		if val&(1<<b) != 0 {
+			data[pos/8] |= 1 << (pos % 8)
+		} else {
+			data[pos/8] &^= 1 << (pos % 8)
+		}
+	}
+}
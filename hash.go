@@ -0,0 +1,93 @@
+package hllpp
+
+import (
+	"fmt"
+
+	"github.com/cespare/xxhash"
+)
+
+// Hasher is the 64-bit hash HLLPP feeds through Add. Pulling this behind an
+// interface lets callers match the hash used by an upstream producer (e.g.
+// a Java job using a specific 64-bit hash) so its HLLs can be merged with
+// ones produced locally.
+type Hasher interface {
+	Sum64(data []byte) uint64
+}
+
+// namedHasher is implemented by the hashers this package ships so their
+// identity can be persisted by MarshalBinary and checked by Merge; a custom
+// Hasher that doesn't implement it can still be used for hashing, but can't
+// be marshaled or safety-checked by name.
+type namedHasher interface {
+	Hasher
+	HasherName() string
+}
+
+// murmurHasher wraps the hash HLLPP has always used, unchanged, as the
+// default Hasher so existing callers of New see no behavior change.
+type murmurHasher struct{}
+
+func (murmurHasher) Sum64(data []byte) uint64 { return legacyMurmurHash64(data) }
+func (murmurHasher) HasherName() string       { return "murmur" }
+
+// xxHasher is measurably faster than murmurHasher on AMD64 for the
+// Add([]byte) hot path used by ingestion pipelines.
+type xxHasher struct{}
+
+func (xxHasher) Sum64(data []byte) uint64 { return xxhash.Sum64(data) }
+func (xxHasher) HasherName() string       { return "xxhash" }
+
+// NewWithHasher is like New, but hashes Add's input with hasher instead of
+// the default.
+func NewWithHasher(p uint8, hasher Hasher) (*HLLPP, error) {
+	h, err := New(p)
+	if err != nil {
+		return nil, err
+	}
+	h.hasher = hasher
+	return h, nil
+}
+
+// NewXXHash is a convenience for NewWithHasher(p, an xxhash-backed Hasher).
+func NewXXHash(p uint8) (*HLLPP, error) {
+	return NewWithHasher(p, xxHasher{})
+}
+
+func hasherName(h Hasher) (string, error) {
+	nh, ok := h.(namedHasher)
+	if !ok {
+		return "", fmt.Errorf("hllpp: hasher type %T has no persistable name", h)
+	}
+	return nh.HasherName(), nil
+}
+
+func hasherByName(name string) (Hasher, error) {
+	switch name {
+	case "", "murmur":
+		return murmurHasher{}, nil
+	case "xxhash":
+		return xxHasher{}, nil
+	default:
+		return nil, fmt.Errorf("hllpp: unknown hasher %q", name)
+	}
+}
+
+// checkHasherCompatibility is used by Merge to reject unioning two HLLs that
+// were populated with different hashers: their registers aren't comparable,
+// and merging them would silently produce a meaningless result rather than
+// an error.
+func checkHasherCompatibility(a, b Hasher) error {
+	an, aok := a.(namedHasher)
+	bn, bok := b.(namedHasher)
+	if !aok || !bok || an.HasherName() != bn.HasherName() {
+		return fmt.Errorf("hllpp: cannot merge HLLs using mismatched hashers (%s vs %s)", hasherDisplayName(a), hasherDisplayName(b))
+	}
+	return nil
+}
+
+func hasherDisplayName(h Hasher) string {
+	if nh, ok := h.(namedHasher); ok {
+		return nh.HasherName()
+	}
+	return fmt.Sprintf("%T", h)
+}
@@ -0,0 +1,66 @@
+package hllpp
+
+import "testing"
+
+func TestNewWithHasherIsUsedByAdd(t *testing.T) {
+	h, err := NewWithHasher(14, xxHasher{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := h.hasher.(xxHasher); !ok {
+		t.Fatalf("expected h.hasher to be xxHasher, got %T", h.hasher)
+	}
+
+	// Add must actually consult h.hasher, not a hardcoded hash: the
+	// register an element lands in depends on which hasher produced its
+	// hash, so an xxhash-backed sketch and a murmur-backed sketch should
+	// disagree about at least one of many elements' registers.
+	m, err := New(14)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 50; i++ {
+		elem := []byte{byte(i)}
+		h.Add(elem)
+		m.Add(elem)
+	}
+
+	differed := false
+	for k := range h.tmpSet {
+		if !m.tmpSet[k] {
+			differed = true
+			break
+		}
+	}
+	if !differed {
+		t.Fatal("expected Add with xxHasher and with the default murmur hasher to land some input in different registers")
+	}
+}
+
+func TestMergeRejectsMismatchedHashers(t *testing.T) {
+	a, err := New(14)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewWithHasher(14, xxHasher{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Add([]byte("a"))
+	b.Add([]byte("b"))
+
+	if err := a.Merge(b); err == nil {
+		t.Fatal("expected Merge to reject mismatched hashers")
+	}
+}
+
+func TestNewXXHash(t *testing.T) {
+	h, err := NewXXHash(14)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := h.hasher.(xxHasher); !ok {
+		t.Fatalf("expected NewXXHash to install xxHasher, got %T", h.hasher)
+	}
+}
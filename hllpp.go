@@ -0,0 +1,303 @@
+package hllpp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// HLLPP is a HyperLogLog++ cardinality estimator, as described in
+// http://research.google.com/pubs/pub40671.html. The zero value is not
+// usable; construct one with New.
+type HLLPP struct {
+	p uint8
+	m uint32
+
+	sparse bool
+
+	// tmpSet accumulates not-yet-merged sparse entries so Add doesn't have
+	// to re-sort the sparse list on every call; mergeRegister folds it into
+	// data once it grows past maxTmpSetLen.
+	tmpSet map[uint32]bool
+
+	// data holds the packed dense register array when !sparse, or the
+	// sorted, merged sparse list (4-byte LE encodeHash entries) when
+	// sparse.
+	data            []byte
+	bitsPerRegister uint8
+
+	hasher Hasher
+}
+
+const (
+	minP = 4
+	maxP = 18
+
+	denseBitsPerRegister = 6
+
+	// Once len(tmpSet) crosses this, mergeRegister flushes it into data
+	// rather than letting Add's inserts pile up unbounded.
+	maxTmpSetLen = 1 << 12
+)
+
+// New returns a new, empty HLLPP at precision p (2^p registers), hashing
+// Add's input with the legacy default hasher. p must be between 4 and 18.
+func New(p uint8) (*HLLPP, error) {
+	if p < minP || p > maxP {
+		return nil, fmt.Errorf("hllpp: p must be between %d and %d, got %d", minP, maxP, p)
+	}
+	return &HLLPP{
+		p:               p,
+		m:               1 << p,
+		sparse:          true,
+		tmpSet:          make(map[uint32]bool),
+		bitsPerRegister: denseBitsPerRegister,
+		hasher:          murmurHasher{},
+	}, nil
+}
+
+// Add adds data's hash to the sketch.
+func (h *HLLPP) Add(data []byte) {
+	x := h.hasher.Sum64(data)
+
+	idx := uint32(x >> (64 - h.p))
+	rest := x << h.p
+
+	var rho uint8
+	if rest == 0 {
+		// All of the non-index bits were zero; cap rho rather than
+		// reporting a run of zeros past the end of the hash.
+		rho = uint8(64-h.p) + 1
+	} else {
+		rho = uint8(leadingZeros64(rest)) + 1
+	}
+
+	h.mergeRegister(idx, rho)
+}
+
+// Merge folds o's registers into h. h and o must share the same p and an
+// identically-named Hasher; mismatches return an error rather than
+// silently producing a meaningless union.
+func (h *HLLPP) Merge(o *HLLPP) error {
+	if h.p != o.p {
+		return fmt.Errorf("hllpp: cannot merge HLLs with different P (%d != %d)", h.p, o.p)
+	}
+	if err := checkHasherCompatibility(h.hasher, o.hasher); err != nil {
+		return err
+	}
+
+	for it := newRegIterator(o); !it.done(); {
+		reg, val := it.next()
+		h.mergeRegister(reg, val)
+	}
+	return nil
+}
+
+// mergeRegister sets register reg to val if val is larger than what's
+// already there, promoting the sparse representation to dense as needed.
+func (h *HLLPP) mergeRegister(reg uint32, val uint8) {
+	if val == 0 {
+		return
+	}
+
+	if h.sparse {
+		h.tmpSet[encodeHash(reg, val)] = true
+		if len(h.tmpSet) > maxTmpSetLen {
+			h.flushTmpSet()
+		}
+		return
+	}
+
+	if val > getRegister(h.data, h.bitsPerRegister, reg) {
+		setRegister(h.data, h.bitsPerRegister, reg, val)
+	}
+}
+
+// flushTmpSet merges any pending tmpSet entries into data, keeping the max
+// value seen per register, and promotes to dense if the sparse list has
+// grown larger than a dense array would be.
+func (h *HLLPP) flushTmpSet() {
+	if !h.sparse {
+		return
+	}
+	if len(h.tmpSet) == 0 && h.data != nil {
+		return
+	}
+
+	merged := make(map[uint32]uint8)
+	for it := newSparseReader(h.data); !it.Done(); {
+		idx, val := h.decodeHash(it.Next(), h.p)
+		if val > merged[idx] {
+			merged[idx] = val
+		}
+	}
+	for k := range h.tmpSet {
+		idx, val := h.decodeHash(k, h.p)
+		if val > merged[idx] {
+			merged[idx] = val
+		}
+	}
+	h.tmpSet = make(map[uint32]bool)
+
+	if h.sparseListTooLarge(len(merged)) {
+		h.promoteToDense(merged)
+		return
+	}
+
+	idxs := make([]uint32, 0, len(merged))
+	for idx := range merged {
+		idxs = append(idxs, idx)
+	}
+	insertionSortUint32(idxs)
+
+	data := make([]byte, 0, len(idxs)*4)
+	for _, idx := range idxs {
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], encodeHash(idx, merged[idx]))
+		data = append(data, buf[:]...)
+	}
+	h.data = data
+}
+
+// sparseListTooLarge reports whether a sparse list with n distinct entries
+// would use more memory than just switching to dense.
+func (h *HLLPP) sparseListTooLarge(n int) bool {
+	return uint64(n)*4 > denseDataLen(h.m)
+}
+
+func (h *HLLPP) promoteToDense(registers map[uint32]uint8) {
+	h.bitsPerRegister = denseBitsPerRegister
+	h.data = make([]byte, denseDataLen(h.m))
+	for idx, val := range registers {
+		setRegister(h.data, h.bitsPerRegister, idx, val)
+	}
+	h.sparse = false
+}
+
+func denseDataLen(m uint32) uint64 {
+	return (uint64(m)*denseBitsPerRegister + 7) / 8
+}
+
+// Count returns h's current cardinality estimate, using the classic HLL
+// estimator (raw harmonic-mean estimate, with the small-range linear
+// counting correction) rather than HLL++'s full empirical bias-correction
+// tables.
+func (h *HLLPP) Count() uint64 {
+	if h.sparse {
+		h.flushTmpSet()
+	}
+
+	registerVal := make(map[uint32]uint8)
+	if h.sparse {
+		for it := newSparseReader(h.data); !it.Done(); {
+			idx, val := h.decodeHash(it.Next(), h.p)
+			registerVal[idx] = val
+		}
+	}
+
+	m := float64(h.m)
+	sum := 0.0
+	zeros := 0
+	for reg := uint32(0); reg < h.m; reg++ {
+		var val uint8
+		if h.sparse {
+			val = registerVal[reg]
+		} else {
+			val = getRegister(h.data, h.bitsPerRegister, reg)
+		}
+		if val == 0 {
+			zeros++
+		}
+		sum += 1.0 / float64(uint64(1)<<val)
+	}
+
+	raw := alpha(h.m) * m * m / sum
+	if raw <= 2.5*m && zeros > 0 {
+		return uint64(m * math.Log(m/float64(zeros)))
+	}
+	return uint64(raw)
+}
+
+func alpha(m uint32) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	default:
+		return 0.7213 / (1 + 1.079/float64(m))
+	}
+}
+
+func leadingZeros64(x uint64) int {
+	n := 0
+	for bit := uint64(1) << 63; bit != 0 && x&bit == 0; bit >>= 1 {
+		n++
+	}
+	return n
+}
+
+func insertionSortUint32(s []uint32) {
+	for i := 1; i < len(s); i++ {
+		for j := i; j > 0 && s[j-1] > s[j]; j-- {
+			s[j-1], s[j] = s[j], s[j-1]
+		}
+	}
+}
+
+// legacyMurmurHash64 is the hash Add used before hashing was made pluggable
+// (see hash.go); it's a straight MurmurHash64A implementation and remains
+// the default Hasher so existing callers of New see no behavior change.
+func legacyMurmurHash64(data []byte) uint64 {
+	const (
+		seed = uint64(0xe17a1465)
+		mul  = uint64(0xc6a4a7935bd1e995)
+		r    = 47
+	)
+
+	hv := seed ^ (uint64(len(data)) * mul)
+
+	n := len(data) / 8
+	for i := 0; i < n; i++ {
+		k := binary.LittleEndian.Uint64(data[i*8:])
+		k *= mul
+		k ^= k >> r
+		k *= mul
+		hv ^= k
+		hv *= mul
+	}
+
+	var k uint64
+	tail := data[n*8:]
+	switch len(tail) {
+	case 7:
+		k ^= uint64(tail[6]) << 48
+		fallthrough
+	case 6:
+		k ^= uint64(tail[5]) << 40
+		fallthrough
+	case 5:
+		k ^= uint64(tail[4]) << 32
+		fallthrough
+	case 4:
+		k ^= uint64(tail[3]) << 24
+		fallthrough
+	case 3:
+		k ^= uint64(tail[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint64(tail[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint64(tail[0])
+		hv ^= k
+		hv *= mul
+	}
+
+	hv ^= hv >> r
+	hv *= mul
+	hv ^= hv >> r
+	return hv
+}
@@ -160,6 +160,100 @@ func setDensePipelineRegister(_p []byte, regnum uint32, val uint8) {
 	_p[_byte+1] |= uint8(_v >> _fb8)
 }
 
+// FromPipeline decodes a blob produced by AsPipeline (or by PipelineDB
+// itself) back into a fully functional HLLPP.
+func FromPipeline(data []byte) (*HLLPP, error) {
+	hdr, body, err := parsePipelineBlob(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch hdr.Encoding {
+	case PipelineDenseClean, PipelineDenseDirty:
+		return fromPipelineDense(hdr.P, body)
+	case PipelineExplicitClean, PipelineExplicitDirty:
+		return fromPipelineExplicit(hdr.P, body)
+	case PipelineSparseClean, PipelineSparseDirty:
+		return fromPipelineSparse(hdr.P, body)
+	default:
+		return nil, fmt.Errorf("hllpp: unknown pipeline HLL encoding byte %q", hdr.Encoding)
+	}
+}
+
+// parsePipelineBlob splits a pipeline blob into its fixed-size preamble and
+// the Mlen-sized register payload that follows it.
+func parsePipelineBlob(data []byte) (pipelineHLL, []byte, error) {
+	preambleLen := binary.Size(pipelineHLL{})
+	if len(data) < preambleLen {
+		return pipelineHLL{}, nil, fmt.Errorf("hllpp: pipeline blob is %d bytes, shorter than the %d-byte preamble", len(data), preambleLen)
+	}
+
+	var hdr pipelineHLL
+	if err := binary.Read(bytes.NewReader(data[:preambleLen]), binary.LittleEndian, &hdr); err != nil {
+		return pipelineHLL{}, nil, err
+	}
+
+	body := data[preambleLen:]
+	if uint32(len(body)) < hdr.Mlen {
+		return pipelineHLL{}, nil, fmt.Errorf("hllpp: pipeline blob declares Mlen %d but only has %d bytes", hdr.Mlen, len(body))
+	}
+	return hdr, body[:hdr.Mlen], nil
+}
+
+func fromPipelineDense(p uint8, body []byte) (*HLLPP, error) {
+	h, err := New(p)
+	if err != nil {
+		return nil, err
+	}
+	for reg := uint32(0); reg < h.m; reg++ {
+		if val := getDensePipelineRegister(body, reg); val != 0 {
+			h.mergeRegister(reg, val)
+		}
+	}
+	return h, nil
+}
+
+func fromPipelineExplicit(p uint8, body []byte) (*HLLPP, error) {
+	if len(body)%4 != 0 {
+		return nil, fmt.Errorf("hllpp: pipeline explicit payload is %d bytes, not a multiple of 4", len(body))
+	}
+
+	h, err := New(p)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i+4 <= len(body); i += 4 {
+		packed := binary.LittleEndian.Uint32(body[i:])
+		h.mergeRegister(packed>>8, uint8(packed))
+	}
+	return h, nil
+}
+
+// fromPipelineSparse decodes PipelineDB's SPARSE encoding, which reuses the
+// same ZERO/XZERO/VAL run-length opcodes as Redis itself (PipelineDB's HLL
+// is a fork of Redis's).
+func fromPipelineSparse(p uint8, body []byte) (*HLLPP, error) {
+	h, err := New(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := decodeSparseOpcodes(h, body); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Straight port of the HLL_DENSE_GET_REGISTER macro; the inverse of
+// setDensePipelineRegister above.
+func getDensePipelineRegister(_p []byte, regnum uint32) uint8 {
+	var _byte uint32 = regnum * pipelineBitsPerRegister / 8
+	var _fb uint32 = regnum * pipelineBitsPerRegister & 7
+	var _fb8 uint32 = 8 - _fb
+
+	var hllRegisterMax uint32 = (1 << pipelineBitsPerRegister) - 1
+	return uint8((uint32(_p[_byte])>>_fb | uint32(_p[_byte+1])<<_fb8) & hllRegisterMax)
+}
+
 // Backing-agnostic iterator of HLL registers.
 type regIterator struct {
 	hll *HLLPP
@@ -170,6 +264,11 @@ type regIterator struct {
 func newRegIterator(h *HLLPP) *regIterator {
 	it := regIterator{hll: h}
 	if h.sparse {
+		// Pending Add()s accumulate in h.tmpSet and aren't reflected in
+		// h.data until flushed; every consumer of this iterator (AsPipeline,
+		// AsRedis, Merge) needs to see them, so flush here rather than
+		// relying on each call site to remember.
+		h.flushTmpSet()
 		it.sr = newSparseReader(h.data)
 	}
 	return &it
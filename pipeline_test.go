@@ -0,0 +1,104 @@
+package hllpp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+func TestPipelineRoundTripDense(t *testing.T) {
+	h, err := New(14)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20000; i++ {
+		h.Add([]byte(fmt.Sprintf("dense-element-%d", i)))
+	}
+
+	blob, err := h.AsPipeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := FromPipeline(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Count() != h.Count() {
+		t.Errorf("dense round trip: got count %d, want %d", got.Count(), h.Count())
+	}
+}
+
+func TestPipelineRoundTripSparse(t *testing.T) {
+	// This package's own AsPipeline never writes SPARSE (convertToDense and
+	// convertToExplicit are the only producers), so fromPipelineSparse only
+	// ever runs against real PipelineDB-produced blobs. PipelineDB's SPARSE
+	// encoding reuses Redis's ZERO/XZERO/VAL opcodes, so build one by
+	// stripping the Redis header off asRedisSparse's output and wrapping the
+	// same opcode body in a pipelineHLL preamble instead.
+	h, err := New(14)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		h.Add([]byte(fmt.Sprintf("sparse-element-%d", i)))
+	}
+
+	redisBlob, ok := h.asRedisSparse()
+	if !ok {
+		t.Fatal("test setup: expected a small HLL to fit the sparse opcode encoding")
+	}
+	opcodes := redisBlob[16:]
+
+	hdr := pipelineHLL{
+		Encoding: PipelineSparseClean,
+		Card:     h.Count(),
+		P:        h.p,
+		Mlen:     uint32(len(opcodes)),
+	}
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, &hdr); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(opcodes)
+
+	got, err := FromPipeline(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Count() != h.Count() {
+		t.Errorf("sparse round trip: got count %d, want %d", got.Count(), h.Count())
+	}
+}
+
+func TestPipelineRoundTripExplicit(t *testing.T) {
+	h, err := New(14)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		h.Add([]byte(fmt.Sprintf("explicit-element-%d", i)))
+	}
+
+	blob, err := h.AsPipeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hdr, _, err := parsePipelineBlob(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Encoding != PipelineExplicitClean {
+		t.Fatalf("expected a small HLL to encode EXPLICIT, got %q", hdr.Encoding)
+	}
+
+	got, err := FromPipeline(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Count() != h.Count() {
+		t.Errorf("explicit round trip: got count %d, want %d", got.Count(), h.Count())
+	}
+}
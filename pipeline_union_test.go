@@ -0,0 +1,211 @@
+package hllpp
+
+import (
+	"fmt"
+	"testing"
+)
+
+func hllWithElements(t *testing.T, p uint8, prefix string, n int) *HLLPP {
+	t.Helper()
+	h, err := New(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		h.Add([]byte(fmt.Sprintf("%s-%d", prefix, i)))
+	}
+	return h
+}
+
+func mergePipelineSlowForTest(t *testing.T, dst, src []byte) []byte {
+	t.Helper()
+	blob, err := mergePipelineSlow(dst, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blob
+}
+
+func countOfPipelineBlob(t *testing.T, blob []byte) uint64 {
+	t.Helper()
+	h, err := FromPipeline(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h.Count()
+}
+
+func TestMergePipelineDenseDense(t *testing.T) {
+	a := hllWithElements(t, 14, "a", 20000)
+	b := hllWithElements(t, 14, "b", 20000)
+
+	aBlob, err := a.AsPipeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bBlob, err := b.AsPipeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fast, err := MergePipeline(aBlob, bBlob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow := mergePipelineSlowForTest(t, aBlob, bBlob)
+
+	fastCount, slowCount := countOfPipelineBlob(t, fast), countOfPipelineBlob(t, slow)
+	if diff := absDiffUint64(fastCount, slowCount); float64(diff)/float64(slowCount) > 0.02 {
+		t.Errorf("MergePipeline count %d too far from slow-path count %d", fastCount, slowCount)
+	}
+}
+
+func TestMergePipelineExplicitExplicitPromotesToDense(t *testing.T) {
+	// Each side stays EXPLICIT on its own, but their union exceeds
+	// maxExplicitRegisters and must promote to DENSE without panicking.
+	a := hllWithElements(t, 14, "x", maxExplicitRegisters-10)
+	b := hllWithElements(t, 14, "y", maxExplicitRegisters-10)
+
+	aBlob, err := a.AsPipeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bBlob, err := b.AsPipeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aHdr, _, err := parsePipelineBlob(aBlob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aHdr.Encoding != PipelineExplicitClean {
+		t.Fatalf("test setup: expected EXPLICIT, got %q", aHdr.Encoding)
+	}
+
+	merged, err := MergePipeline(aBlob, bBlob)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mergedHdr, _, err := parsePipelineBlob(merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mergedHdr.Encoding != PipelineDenseClean {
+		t.Fatalf("expected a union over maxExplicitRegisters to promote to DENSE, got %q", mergedHdr.Encoding)
+	}
+
+	slow := mergePipelineSlowForTest(t, aBlob, bBlob)
+	fastCount, slowCount := countOfPipelineBlob(t, merged), countOfPipelineBlob(t, slow)
+	if diff := absDiffUint64(fastCount, slowCount); float64(diff)/float64(slowCount) > 0.05 {
+		t.Errorf("MergePipeline count %d too far from slow-path count %d", fastCount, slowCount)
+	}
+}
+
+// explicitBlobWithRegisters builds an EXPLICIT pipeline blob with exactly
+// the given distinct (non-overlapping) registers, bypassing Add/AsPipeline
+// so tests can hit exact register counts instead of relying on hashing to
+// land in the right number of distinct registers.
+func explicitBlobWithRegisters(t *testing.T, p uint8, startIdx, n int) []byte {
+	t.Helper()
+	regs := make(RegisterSlice, n)
+	for i := 0; i < n; i++ {
+		regs[i] = Register{Index: uint32(startIdx + i), Value: 1}
+	}
+	blob, err := finishPipelineExplicit(p, regs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blob
+}
+
+func TestMergePipelineExplicitExplicitBoundaryMatchesConvertToExplicit(t *testing.T) {
+	// convertToExplicit promotes to DENSE at len(registers) >=
+	// maxExplicitRegisters; mergePipelineExplicitExplicit must use the same
+	// boundary, or the fast and slow paths disagree on wire format for a
+	// union landing at exactly maxExplicitRegisters registers.
+	a := explicitBlobWithRegisters(t, 14, 0, maxExplicitRegisters/2)
+	b := explicitBlobWithRegisters(t, 14, maxExplicitRegisters/2, maxExplicitRegisters/2)
+
+	merged, err := MergePipeline(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hdr, _, err := parsePipelineBlob(merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Encoding != PipelineDenseClean {
+		t.Fatalf("expected a union of exactly maxExplicitRegisters (%d) registers to promote to DENSE, got %q", maxExplicitRegisters, hdr.Encoding)
+	}
+}
+
+func TestMergePipelineDenseExplicit(t *testing.T) {
+	dense := hllWithElements(t, 14, "dense", 20000)
+	explicit := hllWithElements(t, 14, "explicit", 50)
+
+	denseBlob, err := dense.AsPipeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	explicitBlob, err := explicit.AsPipeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	explicitHdr, _, err := parsePipelineBlob(explicitBlob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if explicitHdr.Encoding != PipelineExplicitClean {
+		t.Fatalf("test setup: expected EXPLICIT, got %q", explicitHdr.Encoding)
+	}
+
+	fast, err := MergePipeline(denseBlob, explicitBlob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow := mergePipelineSlowForTest(t, denseBlob, explicitBlob)
+
+	fastCount, slowCount := countOfPipelineBlob(t, fast), countOfPipelineBlob(t, slow)
+	if diff := absDiffUint64(fastCount, slowCount); float64(diff)/float64(slowCount) > 0.02 {
+		t.Errorf("MergePipeline count %d too far from slow-path count %d", fastCount, slowCount)
+	}
+}
+
+func TestMergePipelineRejectsUnknownEncoding(t *testing.T) {
+	valid, err := hllWithElements(t, 14, "a", 50).AsPipeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	corrupt := make([]byte, len(valid))
+	copy(corrupt, valid)
+	corrupt[0] = '?'
+
+	if _, err := MergePipeline(valid, corrupt); err == nil {
+		t.Fatal("expected MergePipeline to reject an unrecognized encoding byte")
+	}
+}
+
+func TestUnionPipeline(t *testing.T) {
+	blobs := make([][]byte, 0, 5)
+	for i := 0; i < 5; i++ {
+		h := hllWithElements(t, 14, fmt.Sprintf("shard-%d", i), 2000)
+		blob, err := h.AsPipeline()
+		if err != nil {
+			t.Fatal(err)
+		}
+		blobs = append(blobs, blob)
+	}
+
+	union, err := UnionPipeline(blobs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if countOfPipelineBlob(t, union) == 0 {
+		t.Error("expected a non-zero union cardinality")
+	}
+}
@@ -0,0 +1,263 @@
+package hllpp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Redis stores its HyperLogLogs as a 16-byte header followed by either a
+// dense register array or a run-length encoded sparse opcode stream; see
+// hyperloglogCreate()/hllSparseToDense() in redis-server's hyperloglog.c.
+// Unlike the PipelineDB format in pipeline.go, Redis hardcodes P=14 and never
+// stores the precision in the blob itself.
+type redisHLLHeader struct {
+	Magic    [4]byte
+	Encoding byte
+	_        [3]byte
+	Card     uint64
+}
+
+const (
+	redisMagic = "HYLL"
+
+	redisDense  = 0
+	redisSparse = 1
+
+	redisP = 14
+	redisM = 1 << redisP
+
+	// Sparse opcode limits, per HLL_SPARSE_{ZERO,XZERO,VAL}_MAX_* in
+	// hyperloglog.c.
+	redisSparseZeroMaxLen  = 64
+	redisSparseXZeroMaxLen = 16384
+	redisSparseValMaxValue = 32
+	redisSparseValMaxLen   = 4
+)
+
+// AsRedis encodes h in the native Redis HyperLogLog blob format, as read and
+// written by PFADD/PFCOUNT/PFMERGE. The result can be stored directly as a
+// Redis string value.
+func (h *HLLPP) AsRedis() ([]byte, error) {
+	if h.p != redisP {
+		return nil, fmt.Errorf("hllpp: AsRedis requires P=%d, got %d", redisP, h.p)
+	}
+	if h.sparse {
+		if data, ok := h.asRedisSparse(); ok {
+			return data, nil
+		}
+		// Fall through to dense: Redis itself converts a sparse HLL to
+		// dense the moment a register can no longer be described by a VAL
+		// opcode (value > 32), so do the same instead of failing.
+	}
+	return h.asRedisDense()
+}
+
+func redisHeader(encoding byte, card uint64) redisHLLHeader {
+	hdr := redisHLLHeader{Encoding: encoding, Card: card}
+	copy(hdr.Magic[:], redisMagic)
+	return hdr
+}
+
+func (h *HLLPP) asRedisDense() ([]byte, error) {
+	var buf bytes.Buffer
+	hdr := redisHeader(redisDense, h.Count())
+	if err := binary.Write(&buf, binary.LittleEndian, &hdr); err != nil {
+		return nil, err
+	}
+
+	// setDensePipelineRegister always touches the byte after a register's
+	// own bytes (the 2-byte-overlap trick ported from HLL_DENSE_SET_REGISTER),
+	// so the scratch buffer needs one byte of padding beyond the true wire
+	// size, same as convertToDense in pipeline.go.
+	wireLen := (uint64(h.m)*pipelineBitsPerRegister + 7) / 8
+	data := make([]byte, wireLen+1)
+	for it := newRegIterator(h); !it.done(); {
+		reg, val := it.next()
+		setDensePipelineRegister(data, reg, val)
+	}
+	buf.Write(data[:wireLen])
+	return buf.Bytes(), nil
+}
+
+// asRedisSparse greedily coalesces the register stream into ZERO, XZERO and
+// VAL runs. ok is false if some register holds a value a VAL opcode can't
+// represent, in which case the caller should fall back to dense.
+func (h *HLLPP) asRedisSparse() (data []byte, ok bool) {
+	var body bytes.Buffer
+	var zeroRun, valRun uint32
+	var valValue uint8
+
+	flushZero := func() {
+		for zeroRun > 0 {
+			n := zeroRun
+			if n <= redisSparseZeroMaxLen {
+				body.WriteByte(byte(n - 1))
+				zeroRun = 0
+				break
+			}
+			if n > redisSparseXZeroMaxLen {
+				n = redisSparseXZeroMaxLen
+			}
+			l := n - 1
+			body.WriteByte(0x40 | byte(l>>8))
+			body.WriteByte(byte(l))
+			zeroRun -= n
+		}
+	}
+	flushVal := func() {
+		for valRun > 0 {
+			n := valRun
+			if n > redisSparseValMaxLen {
+				n = redisSparseValMaxLen
+			}
+			body.WriteByte(0x80 | byte(valValue-1)<<2 | byte(n-1))
+			valRun -= n
+		}
+	}
+	emitZero := func(n uint32) {
+		flushVal()
+		zeroRun += n
+	}
+	emitVal := func(val uint8) bool {
+		if val > redisSparseValMaxValue {
+			return false
+		}
+		flushZero()
+		if valRun > 0 && val == valValue {
+			valRun++
+		} else {
+			flushVal()
+			valValue, valRun = val, 1
+		}
+		return true
+	}
+
+	var next uint32
+	for it := newRegIterator(h); !it.done(); {
+		reg, val := it.next()
+		if reg > next {
+			emitZero(reg - next)
+		}
+		if val == 0 {
+			emitZero(1)
+		} else if !emitVal(val) {
+			return nil, false
+		}
+		next = reg + 1
+	}
+	if next < h.m {
+		emitZero(h.m - next)
+	}
+	flushZero()
+	flushVal()
+
+	var buf bytes.Buffer
+	hdr := redisHeader(redisSparse, h.Count())
+	if err := binary.Write(&buf, binary.LittleEndian, &hdr); err != nil {
+		return nil, false
+	}
+	buf.Write(body.Bytes())
+	return buf.Bytes(), true
+}
+
+// FromRedis decodes a blob in the native Redis HyperLogLog format, as
+// produced by PFADD or COPY'd out of a Redis string value, into a fully
+// functional HLLPP.
+func FromRedis(data []byte) (*HLLPP, error) {
+	if len(data) < 16 {
+		return nil, fmt.Errorf("hllpp: redis blob is %d bytes, shorter than the 16-byte header", len(data))
+	}
+
+	var hdr redisHLLHeader
+	if err := binary.Read(bytes.NewReader(data[:16]), binary.LittleEndian, &hdr); err != nil {
+		return nil, err
+	}
+	if string(hdr.Magic[:]) != redisMagic {
+		return nil, fmt.Errorf("hllpp: not a redis HLL blob (magic is %q)", hdr.Magic[:])
+	}
+
+	body := data[16:]
+	switch hdr.Encoding {
+	case redisDense:
+		return fromRedisDense(body)
+	case redisSparse:
+		return fromRedisSparse(body)
+	default:
+		return nil, fmt.Errorf("hllpp: unknown redis HLL encoding byte %#x", hdr.Encoding)
+	}
+}
+
+func fromRedisDense(body []byte) (*HLLPP, error) {
+	wantLen := int((uint64(redisM)*pipelineBitsPerRegister + 7) / 8)
+	if len(body) != wantLen {
+		return nil, fmt.Errorf("hllpp: redis dense payload is %d bytes, want %d", len(body), wantLen)
+	}
+
+	// getDensePipelineRegister reads the byte after a register's own bytes
+	// for the last register (same overlap trick as the setter), so pad the
+	// buffer we actually read from by one scratch byte.
+	padded := make([]byte, len(body)+1)
+	copy(padded, body)
+
+	h, err := New(redisP)
+	if err != nil {
+		return nil, err
+	}
+	for reg := uint32(0); reg < redisM; reg++ {
+		if val := getDensePipelineRegister(padded, reg); val != 0 {
+			h.mergeRegister(reg, val)
+		}
+	}
+	return h, nil
+}
+
+func fromRedisSparse(body []byte) (*HLLPP, error) {
+	h, err := New(redisP)
+	if err != nil {
+		return nil, err
+	}
+	if err := decodeSparseOpcodes(h, body); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// decodeSparseOpcodes reads a ZERO/XZERO/VAL run-length encoded register
+// stream, as used by both Redis and (per fromPipelineSparse) PipelineDB, and
+// merges each non-zero register into h. mergeRegister promotes h to dense
+// on its own once enough distinct registers have been merged in, same as it
+// would for a run of Merge() calls.
+func decodeSparseOpcodes(h *HLLPP, body []byte) error {
+	var reg uint32
+	for i := 0; i < len(body); {
+		b := body[i]
+		switch {
+		case b&0xc0 == 0x00: // ZERO
+			reg += uint32(b&0x3f) + 1
+			i++
+		case b&0xc0 == 0x40: // XZERO
+			if i+1 >= len(body) {
+				return fmt.Errorf("hllpp: truncated XZERO opcode at offset %d", i)
+			}
+			reg += uint32(b&0x3f)<<8 | uint32(body[i+1])
+			reg++
+			i += 2
+		default: // VAL
+			val := (b>>2)&0x1f + 1
+			n := uint32(b&0x3) + 1
+			for j := uint32(0); j < n; j++ {
+				if reg >= h.m {
+					return fmt.Errorf("hllpp: sparse payload overruns %d registers", h.m)
+				}
+				h.mergeRegister(reg, val)
+				reg++
+			}
+			i++
+		}
+		if reg > h.m {
+			return fmt.Errorf("hllpp: sparse payload overruns %d registers", h.m)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package hllpp
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRedisRoundTrip(t *testing.T) {
+	h, err := New(redisP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5000; i++ {
+		h.Add([]byte(fmt.Sprintf("redis-element-%d", i)))
+	}
+
+	blob, err := h.AsRedis()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blob) < 16 {
+		t.Fatalf("blob too short: %d bytes", len(blob))
+	}
+
+	got, err := FromRedis(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, got2 := h.Count(), got.Count()
+	if diff := absDiffUint64(want, got2); float64(diff)/float64(want) > 0.05 {
+		t.Errorf("round-tripped count %d too far from original %d", got2, want)
+	}
+}
+
+func TestRedisRoundTripSparse(t *testing.T) {
+	h, err := New(redisP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		h.Add([]byte(fmt.Sprintf("few-%d", i)))
+	}
+	if !h.sparse {
+		t.Fatal("expected a freshly-populated small HLLPP to still be sparse")
+	}
+
+	blob, err := h.AsRedis()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := FromRedis(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Count() != h.Count() {
+		t.Errorf("sparse round trip: got count %d, want %d", got.Count(), h.Count())
+	}
+}
+
+func TestAsRedisRejectsWrongPrecision(t *testing.T) {
+	h, err := New(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.AsRedis(); err == nil {
+		t.Fatal("expected AsRedis to reject P != 14")
+	}
+}
+
+func TestFromRedisRejectsBadMagic(t *testing.T) {
+	blob := make([]byte, 16)
+	copy(blob, "NOPE")
+	if _, err := FromRedis(blob); err == nil {
+		t.Fatal("expected FromRedis to reject a bad magic")
+	}
+}
+
+func absDiffUint64(a, b uint64) uint64 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,55 @@
+package hllpp
+
+import "encoding/binary"
+
+// Sparse representation: data holds a sorted sequence of 4-byte
+// little-endian entries, each produced by encodeHash, one per distinct
+// register. There's no pp/p split here (both are h.p) - every entry
+// already stores the exact (register, rho) pair for the sketch's own
+// precision.
+
+func encodeHash(idx uint32, val uint8) uint32 {
+	return idx<<8 | uint32(val)
+}
+
+// decodeHash is a method (rather than a free function) so callers that
+// eventually grow a real pp/p split only need to change call sites, not
+// every caller's signature.
+func (h *HLLPP) decodeHash(k uint32, p uint8) (idx uint32, val uint8) {
+	return k >> 8, uint8(k)
+}
+
+// sparseReader walks a sparse data buffer's encodeHash entries in order.
+type sparseReader struct {
+	data []byte
+	pos  int
+}
+
+func newSparseReader(data []byte) *sparseReader {
+	return &sparseReader{data: data}
+}
+
+func (s *sparseReader) Done() bool {
+	return s.pos >= len(s.data)
+}
+
+func (s *sparseReader) Next() uint32 {
+	k := binary.LittleEndian.Uint32(s.data[s.pos:])
+	s.pos += 4
+	return k
+}
+
+// Register is a single (index, value) pair, as read out of either
+// representation by regIterator.
+type Register struct {
+	Index uint32
+	Value uint8
+}
+
+// RegisterSlice sorts Registers by Index, as PipelineDB's EXPLICIT encoding
+// requires.
+type RegisterSlice []Register
+
+func (r RegisterSlice) Len() int           { return len(r) }
+func (r RegisterSlice) Less(i, j int) bool { return r[i].Index < r[j].Index }
+func (r RegisterSlice) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }